@@ -0,0 +1,24 @@
+package core
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// BlockReorgHook, when set, is invoked once per block that a chain reorg
+// orphans, symmetric to BlockImportHook being invoked once per newly
+// imported block. reportBlockReorged below is the only thing that calls it;
+// (*BlockChain).reorg must call reportBlockReorged for every block in the
+// old canonical chain that isn't part of the new one, after the chain's own
+// state has already been rolled back to the new head - that call site still
+// needs to be added where reorg walks back to the common ancestor.
+var BlockReorgHook func(bc *BlockChain, removed *types.Block)
+
+// reportBlockReorged invokes BlockReorgHook, if set, for a block a reorg has
+// just discarded. It must be called once per orphaned block from
+// (*BlockChain).reorg's walk back to the common ancestor; see
+// BlockReorgHook's doc comment for the state of that wiring.
+func (bc *BlockChain) reportBlockReorged(removed *types.Block) {
+	if BlockReorgHook != nil {
+		BlockReorgHook(bc, removed)
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TestReportBlockReorgedInvokesHook proves reportBlockReorged's side of the
+// BlockReorgHook wiring: given a hook, it fires with the BlockChain and
+// removed block it was called with. It does not exercise the reorg path
+// itself, since (*BlockChain).reorg isn't part of this package as checked
+// out here; see reportBlockReorged's doc comment.
+func TestReportBlockReorgedInvokesHook(t *testing.T) {
+	bc := new(BlockChain)
+	removed := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+
+	var gotBC *BlockChain
+	var gotBlock *types.Block
+	BlockReorgHook = func(hookBC *BlockChain, block *types.Block) {
+		gotBC, gotBlock = hookBC, block
+	}
+	defer func() { BlockReorgHook = nil }()
+
+	bc.reportBlockReorged(removed)
+
+	if gotBC != bc {
+		t.Errorf("BlockReorgHook called with BlockChain %p, want %p", gotBC, bc)
+	}
+	if gotBlock != removed {
+		t.Errorf("BlockReorgHook called with block %v, want %v", gotBlock, removed)
+	}
+}
+
+// TestReportBlockReorgedNilHook proves reportBlockReorged is a no-op (rather
+// than a nil-pointer panic) when no hook is installed, the state every
+// BlockChain that never calls SinkRegistry.Install is in.
+func TestReportBlockReorgedNilHook(t *testing.T) {
+	BlockReorgHook = nil
+	bc := new(BlockChain)
+	bc.reportBlockReorged(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)}))
+}
@@ -139,6 +139,7 @@ func (t *blockCallsTracer) OnExit(depth int, output []byte, gasUsed uint64, err
 
 	call.GasUsed = gasUsed
 	call.processOutput(output, err, reverted)
+
 	// Nest call into parent.
 	t.callstack[size-1].Calls = append(t.callstack[size-1].Calls, call)
 }
@@ -0,0 +1,95 @@
+// Package dialect rewrites the MySQL-flavored SQL that internal/explorer's
+// sqlsink writer builds into the syntax the configured database driver
+// actually understands, so the same query templates work unmodified
+// against both MySQL and Postgres.
+package dialect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect adapts a query written in MySQL syntax (`?` placeholders,
+// backtick-quoted identifiers) for a specific database driver.
+type Dialect interface {
+	// Name identifies the dialect, e.g. "mysql" or "postgres".
+	Name() string
+	// Rewrite translates query from MySQL syntax into this dialect's own.
+	Rewrite(query string) string
+	// UpsertClause returns the "insert, but update on conflict" clause for
+	// an INSERT into a table whose uniqueness is enforced by conflictCols,
+	// updating updateCols with the values the INSERT attempted to write.
+	// The returned string is appended directly after the INSERT's VALUES
+	// list, leading space included.
+	UpsertClause(conflictCols, updateCols []string) string
+}
+
+// For returns the Dialect for the given driver/scheme name. Anything other
+// than "postgres" defaults to MySQL, since that's the syntax sqlsink's
+// query templates are already written in.
+func For(scheme string) Dialect {
+	if scheme == "postgres" {
+		return Postgres{}
+	}
+	return MySQL{}
+}
+
+// MySQL is the identity dialect: sqlsink's query templates are already
+// written in MySQL syntax, so nothing needs rewriting.
+type MySQL struct{}
+
+func (MySQL) Name() string                { return "mysql" }
+func (MySQL) Rewrite(query string) string { return query }
+
+// UpsertClause builds an ON DUPLICATE KEY UPDATE clause. conflictCols is
+// unused: MySQL infers the conflicting key from the table's own unique
+// index rather than naming it in the statement.
+func (MySQL) UpsertClause(conflictCols, updateCols []string) string {
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = c + " = VALUES(" + c + ")"
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// Postgres rewrites `?` placeholders to `$1, $2, ...` and backtick-quoted
+// identifiers to double-quoted ones, since lib/pq understands neither
+// MySQL form.
+type Postgres struct{}
+
+func (Postgres) Name() string { return "postgres" }
+
+func (Postgres) Rewrite(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			inString = !inString
+			b.WriteByte(c)
+		case c == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		case c == '`' && !inString:
+			b.WriteByte('"')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// UpsertClause builds an ON CONFLICT ... DO UPDATE SET clause naming
+// conflictCols explicitly, since Postgres (unlike MySQL) requires the
+// conflicting unique index's columns in the statement itself.
+func (Postgres) UpsertClause(conflictCols, updateCols []string) string {
+	sets := make([]string, len(updateCols))
+	for i, c := range updateCols {
+		sets[i] = c + " = EXCLUDED." + c
+	}
+	return " ON CONFLICT (" + strings.Join(conflictCols, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
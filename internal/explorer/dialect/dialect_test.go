@@ -0,0 +1,60 @@
+package dialect
+
+import "testing"
+
+func TestPostgresRewrite(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "INSERT INTO internal_transactions (tx_hash, `from`, `to`, value) VALUES (?, ?, ?, ?)",
+			want:  `INSERT INTO internal_transactions (tx_hash, "from", "to", value) VALUES ($1, $2, $3, $4)`,
+		},
+		{
+			query: "UPDATE block_data SET trace_data = ? WHERE number = ? AND hash = ?",
+			want:  "UPDATE block_data SET trace_data = $1 WHERE number = $2 AND hash = $3",
+		},
+		{
+			query: "SELECT 1 WHERE hash = '?'",
+			want:  "SELECT 1 WHERE hash = '?'",
+		},
+	}
+	for _, tt := range tests {
+		if got := (Postgres{}).Rewrite(tt.query); got != tt.want {
+			t.Errorf("Rewrite(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestMySQLRewriteIsIdentity(t *testing.T) {
+	query := "INSERT INTO block_data (number, hash, `value`) VALUES (?, ?, ?)"
+	if got := (MySQL{}).Rewrite(query); got != query {
+		t.Errorf("Rewrite(%q) = %q, want unchanged", query, got)
+	}
+}
+
+func TestMySQLUpsertClause(t *testing.T) {
+	got := (MySQL{}).UpsertClause([]string{"number", "hash"}, []string{"block_data", "trace_data"})
+	want := " ON DUPLICATE KEY UPDATE block_data = VALUES(block_data), trace_data = VALUES(trace_data)"
+	if got != want {
+		t.Errorf("UpsertClause(...) = %q, want %q", got, want)
+	}
+}
+
+func TestPostgresUpsertClause(t *testing.T) {
+	got := (Postgres{}).UpsertClause([]string{"number", "hash"}, []string{"block_data", "trace_data"})
+	want := " ON CONFLICT (number, hash) DO UPDATE SET block_data = EXCLUDED.block_data, trace_data = EXCLUDED.trace_data"
+	if got != want {
+		t.Errorf("UpsertClause(...) = %q, want %q", got, want)
+	}
+}
+
+func TestFor(t *testing.T) {
+	if _, ok := For("postgres").(Postgres); !ok {
+		t.Errorf("For(%q) = %T, want Postgres", "postgres", For("postgres"))
+	}
+	if _, ok := For("mysql").(MySQL); !ok {
+		t.Errorf("For(%q) = %T, want MySQL", "mysql", For("mysql"))
+	}
+}
@@ -0,0 +1,338 @@
+package explorer
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// CallFrame is the explorer's view of a single call-stack frame produced by
+// the blockCallsTracer. It mirrors the tracer's own callFrame, but lives
+// here so that Sink implementations don't need to import the tracer package.
+//
+// copied from eth/tracers/native/call.go
+type CallFrame struct {
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to,omitempty" rlp:"optional"`
+	Calls        []CallFrame     `json:"calls,omitempty" rlp:"optional"`
+	Value        *hexutil.Big    `json:"value,omitempty" rlp:"optional"`
+	TypeString   string          `json:"type"`
+	Gas          hexutil.Uint64  `json:"gas"`
+	GasUsed      hexutil.Uint64  `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input" rlp:"optional"`
+	Output       hexutil.Bytes   `json:"output,omitempty" rlp:"optional"`
+	Error        string          `json:"error,omitempty" rlp:"optional"`
+	RevertReason string          `json:"revertReason,omitempty"`
+}
+
+// TraceAddress formats a call-frame path the way Parity/OpenEthereum-style
+// traces expose it, e.g. []int{0, 2, 1} -> "[0,2,1]".
+func TraceAddress(path []int) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = strconv.Itoa(p)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// Sink receives block-import events, the way core/tracing.Hooks lets
+// multiple live tracers observe the same execution. Registering a Sink with
+// a SinkRegistry never displaces another sink, so e.g. a SQL writer and a
+// Kafka writer can observe the same chain side by side.
+type Sink interface {
+	// OnBlockStart is called once per imported block, before any of the
+	// block's internal transactions or trace data are reported.
+	OnBlockStart(block *types.Block)
+	// OnBlockEnd is called once per imported block with the marshalled
+	// RPC-style block data, whether or not the block has trace data
+	// attached. It is skipped only if marshalling the block data fails.
+	OnBlockEnd(block *types.Block, receipts types.Receipts, blockData []byte)
+	// OnTrace is called with the raw trace payload captured for the block,
+	// before it is decoded into individual call frames for OnInternalTx.
+	// It is only called when trace data is available.
+	OnTrace(block *types.Block, traceData []byte)
+	// OnInternalTx is called once per internal call frame extracted from a
+	// block's trace data, except zero-value CALL frames when
+	// SinkRegistry.StoreZeroValueCalls is false. traceAddress identifies the frame's position in
+	// the call tree the way Parity/OpenEthereum traces do, e.g. [0,2,1].
+	OnInternalTx(block *types.Block, txIndex int, callIndex int, traceAddress []int, frame CallFrame)
+}
+
+// ReorgSink is an optional interface a Sink may implement to clean up rows
+// for blocks that fall out of the canonical chain during a reorg. Blocks
+// that become canonical in the same reorg need no special handling: they
+// continue to flow through the normal OnBlockStart/OnBlockEnd/OnTrace path,
+// same as any other imported block.
+type ReorgSink interface {
+	// OnBlockRemoved is called once per block that a reorg has orphaned,
+	// so the Sink can delete whatever it stored for that (number, hash).
+	OnBlockRemoved(block *types.Block)
+}
+
+// Closer is an optional interface a Sink may implement to flush buffered
+// writes and release resources on shutdown. SinkRegistry.Close calls it for
+// every registered Sink that implements it.
+type Closer interface {
+	Close() error
+}
+
+// SinkConfig carries the connection parameters and queueing knobs used to
+// construct a Sink from a SinkFactory.
+type SinkConfig struct {
+	// Params is the driver-specific connection string/DSN, e.g. a MySQL DSN
+	// or a Postgres "key=value" string.
+	Params string
+	// MaxQueue bounds how many events a Sink may buffer ahead of its own
+	// writes. Sinks that queue asynchronously (e.g. sqlsink) drop events
+	// and log a warning past this bound, rather than stalling block import.
+	// Zero means "use the Sink's own default".
+	MaxQueue int
+}
+
+// SinkFactory builds a Sink from the configuration parsed by
+// SetupExplorerDB. Sink implementations register a factory for the URL
+// scheme(s) they handle from an init function, mirroring how
+// tracers.DefaultDirectory.Register works for live tracers.
+type SinkFactory func(cfg SinkConfig) (Sink, error)
+
+var (
+	sinkFactoriesMu sync.Mutex
+	sinkFactories   = make(map[string]SinkFactory)
+)
+
+// RegisterSinkFactory registers a SinkFactory under the given scheme (e.g.
+// "mysql" or "postgres"). It is intended to be called from a Sink
+// implementation's init function.
+func RegisterSinkFactory(scheme string, factory SinkFactory) {
+	sinkFactoriesMu.Lock()
+	defer sinkFactoriesMu.Unlock()
+	if _, exists := sinkFactories[scheme]; exists {
+		panic("explorer: sink factory already registered for scheme " + scheme)
+	}
+	sinkFactories[scheme] = factory
+}
+
+func newSink(scheme string, cfg SinkConfig) (Sink, error) {
+	sinkFactoriesMu.Lock()
+	factory, ok := sinkFactories[scheme]
+	sinkFactoriesMu.Unlock()
+	if !ok {
+		return nil, errUnknownScheme(scheme)
+	}
+	return factory(cfg)
+}
+
+type errUnknownScheme string
+
+func (e errUnknownScheme) Error() string {
+	return "explorer: no sink registered for scheme " + string(e)
+}
+
+// SinkRegistry composes an arbitrary number of Sinks under a single
+// blockCallsTracer instance, and installs itself into the core block-import
+// hooks. Sinks are fanned out to in registration order.
+type SinkRegistry struct {
+	mu    sync.RWMutex
+	sinks []Sink
+
+	tracer *tracers.Tracer
+
+	// StoreZeroValueCalls controls whether zero-value CALL frames are
+	// reported to sinks via OnInternalTx, as opposed to only value-transfer
+	// calls, CREATE/CREATE2/DELEGATECALL/STATICCALL and SELFDESTRUCT.
+	// blockCallsTracer's own output (and hence debug_traceBlock and any
+	// other consumer of trace_data) is unaffected either way: this only
+	// filters what gets written here, so that the trace_address computed
+	// for a kept frame always matches its position in the real call tree.
+	StoreZeroValueCalls bool
+}
+
+// NewSinkRegistry creates an empty SinkRegistry.
+func NewSinkRegistry() *SinkRegistry {
+	return &SinkRegistry{}
+}
+
+// Register adds a Sink to the registry. It is safe to call concurrently
+// with block import.
+func (r *SinkRegistry) Register(sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, sink)
+}
+
+// Install wires the registry into core.BlockImportHook, core.BlockTraceSetup,
+// core.BlockTraceGetResult and core.BlockReorgHook. It replaces any hooks previously installed
+// there.
+func (r *SinkRegistry) Install() {
+	core.BlockImportHook = r.blockImportHook
+	core.BlockTraceSetup = r.blockTraceSetup
+	core.BlockTraceGetResult = r.blockTraceGetResult
+	core.BlockReorgHook = r.blockReorgHook
+}
+
+// blockReorgHook implements core.BlockReorgHook, a hook symmetric to
+// BlockImportHook that (*core.BlockChain).reportBlockReorged invokes for an
+// orphaned block, so Sinks that implement ReorgSink can delete their stale
+// rows. See core.BlockReorgHook's doc comment for where it is called from.
+// The blocks that become canonical in the same reorg need no special
+// handling here: BlockChain still calls BlockImportHook for them, the same
+// as any other imported block.
+func (r *SinkRegistry) blockReorgHook(bc *core.BlockChain, removed *types.Block) {
+	r.mu.RLock()
+	sinks := r.sinks
+	r.mu.RUnlock()
+
+	for _, sink := range sinks {
+		if rs, ok := sink.(ReorgSink); ok {
+			rs.OnBlockRemoved(removed)
+		}
+	}
+}
+
+// Close flushes every registered Sink that implements Closer and releases
+// its resources. Node shutdown (Stop) must call this - e.g. via
+// DefaultRegistry().Close() - since Sinks like sqlsink buffer writes
+// asynchronously and lose whatever hasn't been flushed yet if the process
+// simply exits.
+func (r *SinkRegistry) Close() error {
+	r.mu.RLock()
+	sinks := r.sinks
+	r.mu.RUnlock()
+
+	var err error
+	for _, sink := range sinks {
+		if c, ok := sink.(Closer); ok {
+			if cerr := c.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// APIProvider is implemented by Sinks that expose additional RPC methods on
+// top of observing block import, e.g. sqlsink's "explorer" namespace for
+// querying cached trace data.
+type APIProvider interface {
+	APIs() []rpc.API
+}
+
+// APIs collects the rpc.API values exposed by every registered Sink that
+// implements APIProvider, for the caller to pass through to the node's RPC
+// API registration alongside eth, debug, etc.
+func (r *SinkRegistry) APIs() []rpc.API {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var apis []rpc.API
+	for _, sink := range r.sinks {
+		if p, ok := sink.(APIProvider); ok {
+			apis = append(apis, p.APIs()...)
+		}
+	}
+	return apis
+}
+
+func (r *SinkRegistry) blockTraceSetup(c *vm.Config) {
+	r.mu.Lock()
+	if r.tracer == nil {
+		tracer, err := tracers.DefaultDirectory.New("blockCallsTracer", new(tracers.Context), nil)
+		if err != nil {
+			r.mu.Unlock()
+			panic(err)
+		}
+		r.tracer = tracer
+	}
+	tracer := r.tracer
+	r.mu.Unlock()
+	c.Tracer = tracer.Hooks
+}
+
+func (r *SinkRegistry) blockTraceGetResult(c *vm.Config) ([]byte, error) {
+	r.mu.RLock()
+	tracer := r.tracer
+	r.mu.RUnlock()
+	if tracer == nil {
+		panic("blockTracer is not set up.")
+	}
+	return tracer.GetResult()
+}
+
+func (r *SinkRegistry) blockImportHook(bc *core.BlockChain, block *types.Block, receipts types.Receipts, traceData []byte) map[string]interface{} {
+	r.mu.RLock()
+	sinks := r.sinks
+	r.mu.RUnlock()
+
+	for _, sink := range sinks {
+		sink.OnBlockStart(block)
+	}
+
+	blockData := ethapi.RPCMarshalBlockEx(bc, block, receipts, traceData)
+	jsonData, err := json.Marshal(blockData)
+	if err != nil {
+		log.Error("Failed to marshal block data", "number", block.Number(), "hash", block.Hash(), "err", err)
+		return nil
+	}
+
+	for _, sink := range sinks {
+		sink.OnBlockEnd(block, receipts, jsonData)
+	}
+
+	if len(traceData) != 0 {
+		for _, sink := range sinks {
+			sink.OnTrace(block, traceData)
+		}
+
+		var callstacks [][]CallFrame
+		if err := json.Unmarshal(traceData, &callstacks); err != nil {
+			log.Error("Failed to unmarshal trace data", "number", block.Number(), "hash", block.Hash(), "err", err)
+		} else {
+			for txIndex, callstack := range callstacks {
+				callIndex := 0
+				for i, frame := range callstack {
+					navigateCallFrame(block, txIndex, &callIndex, []int{i}, frame, sinks, r.StoreZeroValueCalls)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// navigateCallFrame walks a call frame tree depth-first, reporting every
+// frame to each sink along with its trace_address path, except zero-value
+// CALL frames when storeZeroValueCalls is false. traceAddress is computed
+// from the tree blockCallsTracer actually produced, regardless of which
+// frames get reported, so a kept frame's trace_address always matches the
+// position debug_traceBlock (or any other trace_data consumer) would report
+// for it. callIndex counts only the reported frames, so it numbers them
+// consecutively from 0 within each transaction.
+func navigateCallFrame(block *types.Block, txIndex int, callIndex *int, traceAddress []int, frame CallFrame, sinks []Sink, storeZeroValueCalls bool) {
+	if storeZeroValueCalls || !isZeroValueCall(frame) {
+		for _, sink := range sinks {
+			sink.OnInternalTx(block, txIndex, *callIndex, traceAddress, frame)
+		}
+		*callIndex++
+	}
+	for i, call := range frame.Calls {
+		navigateCallFrame(block, txIndex, callIndex, append(append([]int{}, traceAddress...), i), call, sinks, storeZeroValueCalls)
+	}
+}
+
+// isZeroValueCall reports whether frame is a plain value-transfer CALL with
+// no value attached - the bulk of contract-to-contract calls, and the
+// noisiest part of a block's call tree. CREATE/CREATE2/DELEGATECALL/
+// STATICCALL and SELFDESTRUCT are never considered zero-value.
+func isZeroValueCall(frame CallFrame) bool {
+	return frame.TypeString == vm.CALL.String() && (frame.Value == nil || frame.Value.ToInt().Sign() == 0)
+}
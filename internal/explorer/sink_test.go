@@ -0,0 +1,40 @@
+package explorer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type fakeReorgSink struct {
+	removed []*types.Block
+}
+
+func (f *fakeReorgSink) OnBlockStart(block *types.Block)                                     {}
+func (f *fakeReorgSink) OnBlockEnd(block *types.Block, receipts types.Receipts, data []byte) {}
+func (f *fakeReorgSink) OnTrace(block *types.Block, traceData []byte)                        {}
+func (f *fakeReorgSink) OnInternalTx(block *types.Block, txIndex, callIndex int, traceAddress []int, frame CallFrame) {
+}
+func (f *fakeReorgSink) OnBlockRemoved(block *types.Block) {
+	f.removed = append(f.removed, block)
+}
+
+// TestSinkRegistryBlockReorgHook proves the half of the reorg-cleanup path
+// SinkRegistry owns: once core.BlockReorgHook is invoked, registered Sinks
+// implementing ReorgSink receive OnBlockRemoved. The core side,
+// reportBlockReorged invoking core.BlockReorgHook, is covered by
+// core.TestReportBlockReorgedInvokesHook; neither test exercises
+// BlockChain's reorg path itself.
+func TestSinkRegistryBlockReorgHook(t *testing.T) {
+	r := NewSinkRegistry()
+	reorg := &fakeReorgSink{}
+	r.Register(reorg)
+
+	removed := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	r.blockReorgHook(nil, removed)
+
+	if len(reorg.removed) != 1 || reorg.removed[0] != removed {
+		t.Fatalf("OnBlockRemoved got %v, want [%v]", reorg.removed, removed)
+	}
+}
@@ -0,0 +1,174 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ChainReader is the subset of *core.BlockChain the explorer API needs to
+// resolve a block number/hash for the live-tracer fallback.
+type ChainReader interface {
+	GetBlockByHash(hash common.Hash) *types.Block
+	GetBlockByNumber(number uint64) *types.Block
+}
+
+// LiveTracer re-executes a block's transactions with the blockCallsTracer
+// when no cached trace_data row exists for it, e.g. because indexing
+// started after the block was imported. Implementations typically wrap
+// eth/tracers.API's own block tracing.
+type LiveTracer interface {
+	TraceBlock(ctx context.Context, block *types.Block) (json.RawMessage, error)
+}
+
+var (
+	errBlockNotFound = errors.New("explorer: block not found")
+	errNoTraceData   = errors.New("explorer: no trace data available for block")
+)
+
+// TxTraceResult pairs a single transaction's call trace with its hash, the
+// way scroll-tech's txTraceResult extension does, so callers can correlate
+// results without a second lookup.
+type TxTraceResult struct {
+	TxHash common.Hash     `json:"txHash"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// InternalTransaction is a single call frame as stored in
+// internal_transactions, returned by explorer_getInternalTransactions.
+type InternalTransaction struct {
+	BlockNumber  int64           `json:"blockNumber"`
+	BlockHash    common.Hash     `json:"blockHash"`
+	TxIndex      int             `json:"transactionIndex"`
+	CallIndex    int             `json:"callIndex"`
+	TraceAddress string          `json:"traceAddress"`
+	Depth        int             `json:"depth"`
+	Type         string          `json:"type"`
+	From         common.Address  `json:"from"`
+	To           *common.Address `json:"to,omitempty"`
+	Value        string          `json:"value,omitempty"`
+	Gas          uint64          `json:"gas"`
+	GasUsed      uint64          `json:"gasUsed"`
+	Input        hexutil.Bytes   `json:"input,omitempty"`
+	Output       hexutil.Bytes   `json:"output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	RevertReason string          `json:"revertReason,omitempty"`
+}
+
+// API implements the "explorer" RPC namespace, serving trace data from the
+// SQL store a Sink writes to, with a LiveTracer fallback for blocks that
+// were never indexed. This matches the pattern of ipld-eth-server's tracing
+// endpoints: a cached/archival fast path, with re-execution as the
+// fallback, instead of requiring --gcmode=archive.
+type API struct {
+	sink *Sink
+}
+
+// TraceBlockByNumber implements explorer_traceBlockByNumber.
+func (api *API) TraceBlockByNumber(ctx context.Context, number rpc.BlockNumber) ([]*TxTraceResult, error) {
+	bc, _ := api.sink.chainContext()
+	if bc == nil {
+		return nil, errBlockNotFound
+	}
+	block := bc.GetBlockByNumber(uint64(number.Int64()))
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// TraceBlockByHash implements explorer_traceBlockByHash.
+func (api *API) TraceBlockByHash(ctx context.Context, hash common.Hash) ([]*TxTraceResult, error) {
+	bc, _ := api.sink.chainContext()
+	if bc == nil {
+		return nil, errBlockNotFound
+	}
+	block := bc.GetBlockByHash(hash)
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	return api.traceBlock(ctx, block)
+}
+
+// GetInternalTransactions implements explorer_getInternalTransactions.
+func (api *API) GetInternalTransactions(ctx context.Context, txHash common.Hash) ([]*InternalTransaction, error) {
+	query := api.sink.writer.dialect.Rewrite(
+		"SELECT block_number, block_hash, tx_index, call_index, trace_address, depth, type, `from`, `to`, value, gas, gas_used, input, output, error, revert_reason " +
+			"FROM internal_transactions WHERE tx_hash = ? ORDER BY call_index ASC")
+	rows, err := api.sink.DB().QueryContext(ctx, query, txHash.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []*InternalTransaction
+	for rows.Next() {
+		var (
+			t                   InternalTransaction
+			blockHash, fromAddr string
+			toAddr              sql.NullString
+		)
+		if err := rows.Scan(&t.BlockNumber, &blockHash, &t.TxIndex, &t.CallIndex, &t.TraceAddress, &t.Depth, &t.Type,
+			&fromAddr, &toAddr, &t.Value, &t.Gas, &t.GasUsed, &t.Input, &t.Output, &t.Error, &t.RevertReason); err != nil {
+			return nil, err
+		}
+		t.BlockHash = common.HexToHash(blockHash)
+		t.From = common.HexToAddress(fromAddr)
+		if toAddr.Valid && toAddr.String != "" {
+			addr := common.HexToAddress(toAddr.String)
+			t.To = &addr
+		}
+		out = append(out, &t)
+	}
+	return out, rows.Err()
+}
+
+// traceBlock serves a block's trace from trace_data if present, falling
+// back to live re-execution otherwise.
+func (api *API) traceBlock(ctx context.Context, block *types.Block) ([]*TxTraceResult, error) {
+	var traceData sql.NullString
+	query := api.sink.writer.dialect.Rewrite("SELECT trace_data FROM block_data WHERE number = ? AND hash = ?")
+	err := api.sink.DB().QueryRowContext(ctx, query, block.Number().Int64(), block.Hash().Hex()).Scan(&traceData)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && traceData.Valid && traceData.String != "" {
+		return decorateWithTxHash(block, json.RawMessage(traceData.String))
+	}
+
+	_, live := api.sink.chainContext()
+	if live == nil {
+		return nil, errNoTraceData
+	}
+	raw, err := live.TraceBlock(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	return decorateWithTxHash(block, raw)
+}
+
+// decorateWithTxHash attaches each transaction's hash to its per-tx trace
+// result, per scroll-tech's txTraceResult extension.
+func decorateWithTxHash(block *types.Block, raw json.RawMessage) ([]*TxTraceResult, error) {
+	var callstacks []json.RawMessage
+	if err := json.Unmarshal(raw, &callstacks); err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	results := make([]*TxTraceResult, len(callstacks))
+	for i, cs := range callstacks {
+		r := &TxTraceResult{Result: cs}
+		if i < len(txs) {
+			r.TxHash = txs[i].Hash()
+		}
+		results[i] = r
+	}
+	return results, nil
+}
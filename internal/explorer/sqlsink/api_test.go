@@ -0,0 +1,178 @@
+package sqlsink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeDriver backs a database/sql.DB with canned responses so
+// TraceBlockByNumber/TraceBlockByHash can be driven through both the
+// cached-row and live-fallback branches without a real database. name, the
+// dataSourceName passed to sql.Open, selects whether the fake's trace_data
+// lookup returns a row ("cached") or none ("nocache").
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{mode: name}, nil
+}
+
+func init() {
+	sql.Register("sqlsinkfake", fakeDriver{})
+}
+
+type fakeConn struct{ mode string }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("sqlsinkfake: transactions not supported")
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.Contains(s.query, "trace_data") {
+		return &fakeRows{}, nil
+	}
+	if s.conn.mode != "cached" {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{
+		cols: []string{"trace_data"},
+		rows: [][]driver.Value{{`[[{"type":"CALL"}]]`}},
+	}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// fakeChainReader implements ChainReader by serving a single fixed block
+// regardless of the number/hash requested.
+type fakeChainReader struct{ block *types.Block }
+
+func (f fakeChainReader) GetBlockByHash(hash common.Hash) *types.Block { return f.block }
+func (f fakeChainReader) GetBlockByNumber(number uint64) *types.Block  { return f.block }
+
+// fakeLiveTracer implements LiveTracer, recording whether it was invoked so
+// tests can assert the live-fallback path actually ran.
+type fakeLiveTracer struct {
+	called bool
+	result json.RawMessage
+}
+
+func (f *fakeLiveTracer) TraceBlock(ctx context.Context, block *types.Block) (json.RawMessage, error) {
+	f.called = true
+	return f.result, nil
+}
+
+func newTestSink(t *testing.T, mode string) *Sink {
+	t.Helper()
+	sink, err := New("sqlsinkfake", mode, 0)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := sink.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	})
+	return sink
+}
+
+// TestTraceBlockCachedRow proves TraceBlockByNumber/TraceBlockByHash serve
+// trace_data straight from the database, without calling the LiveTracer,
+// once SetChainContext has wired a ChainReader - the part of chunk0-4's RPC
+// methods that was unreachable before anything called SetChainContext.
+func TestTraceBlockCachedRow(t *testing.T) {
+	sink := newTestSink(t, "cached")
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	live := &fakeLiveTracer{}
+	sink.SetChainContext(fakeChainReader{block: block}, live)
+
+	api := &API{sink: sink}
+	for name, call := range map[string]func() ([]*TxTraceResult, error){
+		"ByNumber": func() ([]*TxTraceResult, error) { return api.TraceBlockByNumber(context.Background(), 1) },
+		"ByHash":   func() ([]*TxTraceResult, error) { return api.TraceBlockByHash(context.Background(), block.Hash()) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			live.called = false
+			results, err := call()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if len(results) != 1 {
+				t.Fatalf("%s: got %d results, want 1", name, len(results))
+			}
+			if live.called {
+				t.Errorf("%s: live tracer was called, want cached row served directly", name)
+			}
+		})
+	}
+}
+
+// TestTraceBlockLiveFallback proves the reverse: when no trace_data row
+// exists, TraceBlockByNumber/TraceBlockByHash fall back to LiveTracer.
+func TestTraceBlockLiveFallback(t *testing.T) {
+	sink := newTestSink(t, "nocache")
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)})
+	live := &fakeLiveTracer{result: json.RawMessage(`[[{"type":"CALL"}]]`)}
+	sink.SetChainContext(fakeChainReader{block: block}, live)
+
+	api := &API{sink: sink}
+	results, err := api.TraceBlockByNumber(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("TraceBlockByNumber: %v", err)
+	}
+	if !live.called {
+		t.Errorf("live tracer was not called, want the no-cached-row fallback to reach it")
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+}
+
+// TestTraceBlockNoChainContext proves the current, honest failure mode: a
+// Sink that never had SetChainContext called (the state every Sink is in
+// today, since nothing in this tree calls it yet) reports errBlockNotFound
+// rather than panicking.
+func TestTraceBlockNoChainContext(t *testing.T) {
+	sink := newTestSink(t, "cached")
+	api := &API{sink: sink}
+	if _, err := api.TraceBlockByNumber(context.Background(), 1); err != errBlockNotFound {
+		t.Errorf("got err %v, want errBlockNotFound", err)
+	}
+}
@@ -0,0 +1,176 @@
+// Package sqlsink implements explorer.Sink on top of database/sql, writing
+// block and internal-transaction data to MySQL or Postgres. It is the
+// direct successor of the writer that used to be hard-wired into
+// internal/explorer.SetupExplorerDB.
+package sqlsink
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/internal/explorer"
+	"github.com/ethereum/go-ethereum/internal/explorer/dialect"
+	"github.com/ethereum/go-ethereum/rpc"
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	explorer.RegisterSinkFactory("mysql", func(cfg explorer.SinkConfig) (explorer.Sink, error) {
+		return New("mysql", cfg.Params, cfg.MaxQueue)
+	})
+	explorer.RegisterSinkFactory("postgres", func(cfg explorer.SinkConfig) (explorer.Sink, error) {
+		return New("postgres", cfg.Params, cfg.MaxQueue)
+	})
+}
+
+// Sink writes block and internal-transaction data to a SQL database via
+// database/sql, using the given driver name ("mysql" or "postgres"). Writes
+// are handed off to a Writer goroutine so a slow database never stalls
+// block import.
+type Sink struct {
+	writer *Writer
+
+	mu   sync.RWMutex
+	bc   ChainReader
+	live LiveTracer
+}
+
+// New opens a connection to the database identified by params using the
+// given database/sql driver name, pings it to fail fast on bad
+// configuration, and starts its Writer goroutine. maxQueue is forwarded to
+// newWriter; zero uses the default queue size.
+//
+// Query templates are written once in MySQL syntax and rewritten for
+// Postgres by dialect.For(driverName); see writer.go. Schema-wise, the
+// "value" column (a 256-bit unsigned integer stored as a decimal string)
+// should be declared DECIMAL(65,0) on MySQL or NUMERIC(78,0) on Postgres so
+// it round-trips without truncation.
+func New(driverName, params string, maxQueue int) (*Sink, error) {
+	db, err := sql.Open(driverName, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	writer, err := newWriter(db, dialect.For(driverName), maxQueue)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{writer: writer}, nil
+}
+
+// DB returns the underlying database handle, for read-only use by API.
+func (s *Sink) DB() *sql.DB {
+	return s.writer.db
+}
+
+// Close implements explorer.Closer, flushing any buffered writes and
+// stopping the writer goroutine.
+func (s *Sink) Close() error {
+	s.writer.Close()
+	return nil
+}
+
+// SetChainContext wires the chain reader and live-tracer fallback used by
+// the "explorer" RPC API (see api.go). SetupExplorerDB runs before the
+// node's blockchain exists, so this must be called separately once it's
+// available - e.g. from node backend setup, right after the BlockChain and
+// eth/tracers.API are constructed. That call site isn't part of this
+// checkout; see api_test.go's TestTraceBlockCachedRow/LiveFallback for
+// proof the cached-row and live-fallback branches behave correctly once it
+// is called, and TestTraceBlockNoChainContext for today's actual behavior
+// in its absence.
+func (s *Sink) SetChainContext(bc ChainReader, live LiveTracer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bc, s.live = bc, live
+}
+
+func (s *Sink) chainContext() (ChainReader, LiveTracer) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bc, s.live
+}
+
+// APIs implements explorer.APIProvider, exposing the "explorer" namespace.
+func (s *Sink) APIs() []rpc.API {
+	return []rpc.API{{
+		Namespace: "explorer",
+		Service:   &API{sink: s},
+	}}
+}
+
+// OnBlockStart implements explorer.Sink.
+func (s *Sink) OnBlockStart(block *types.Block) {}
+
+// OnBlockEnd implements explorer.Sink.
+func (s *Sink) OnBlockEnd(block *types.Block, receipts types.Receipts, blockData []byte) {
+	s.writer.enqueue(writerEvent{
+		kind:   evBlockInsert,
+		number: block.Number().Int64(),
+		hash:   block.Hash().Hex(),
+		data:   string(blockData),
+	})
+}
+
+// OnTrace implements explorer.Sink.
+func (s *Sink) OnTrace(block *types.Block, traceData []byte) {
+	s.writer.enqueue(writerEvent{
+		kind:   evTraceUpdate,
+		number: block.Number().Int64(),
+		hash:   block.Hash().Hex(),
+		data:   string(traceData),
+	})
+}
+
+// OnBlockRemoved implements explorer.ReorgSink, deleting the block_data and
+// internal_transactions rows for a block a reorg has orphaned.
+func (s *Sink) OnBlockRemoved(block *types.Block) {
+	s.writer.enqueue(writerEvent{
+		kind:   evBlockDelete,
+		number: block.Number().Int64(),
+		hash:   block.Hash().Hex(),
+	})
+}
+
+// OnInternalTx implements explorer.Sink.
+//
+// internal_transactions additionally carries: type, trace_address, depth,
+// gas, gas_used, input, output, error and revert_reason, so CREATE,
+// CREATE2, DELEGATECALL, STATICCALL and SELFDESTRUCT frames round-trip with
+// the same detail as a plain value-transfer CALL.
+func (s *Sink) OnInternalTx(block *types.Block, txIndex int, callIndex int, traceAddress []int, frame explorer.CallFrame) {
+	var to string
+	if frame.To != nil {
+		to = frame.To.Hex()
+	}
+	// value is written as a decimal string; a frame without a value
+	// transferred nothing, so it is stored as 0.
+	value := "0"
+	if frame.Value != nil {
+		value = frame.Value.ToInt().String()
+	}
+	s.writer.enqueue(writerEvent{
+		kind:         evInternalTx,
+		number:       block.Number().Int64(),
+		hash:         block.Hash().Hex(),
+		txHash:       block.Transactions()[txIndex].Hash().Hex(),
+		txIndex:      txIndex,
+		callIndex:    callIndex,
+		traceAddress: explorer.TraceAddress(traceAddress),
+		depth:        len(traceAddress),
+		typ:          frame.TypeString,
+		from:         frame.From.Hex(),
+		to:           to,
+		value:        value,
+		gas:          uint64(frame.Gas),
+		gasUsed:      uint64(frame.GasUsed),
+		input:        []byte(frame.Input),
+		output:       []byte(frame.Output),
+		errStr:       frame.Error,
+		revertReason: frame.RevertReason,
+	})
+}
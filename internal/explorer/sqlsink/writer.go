@@ -0,0 +1,334 @@
+package sqlsink
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/internal/explorer/dialect"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	defaultMaxQueue    = 10000
+	defaultBatchSize   = 200
+	defaultFlushPeriod = 2 * time.Second
+
+	// blockInsertSQL upserts on (number, hash) so replaying an
+	// already-indexed tip, or re-inserting a block that becomes canonical
+	// again after a reorg, doesn't crash on the primary key. The upsert
+	// clause itself is dialect-specific (see blockConflictCols below) and is
+	// appended by newWriter via dialect.Dialect.UpsertClause.
+	blockInsertSQL = "INSERT INTO block_data (number, hash, block_data) VALUES "
+
+	traceUpdateSQL = "UPDATE block_data SET trace_data = ? WHERE number = ? AND hash = ?"
+
+	internalTxInsertSQL = "INSERT INTO internal_transactions " +
+		"(tx_hash, block_number, block_hash, tx_index, call_index, trace_address, depth, type, `from`, `to`, value, gas, gas_used, input, output, error, revert_reason) VALUES "
+
+	blockDeleteSQL      = "DELETE FROM block_data WHERE number = ? AND hash = ?"
+	internalTxDeleteSQL = "DELETE FROM internal_transactions WHERE block_number = ? AND block_hash = ?"
+)
+
+// blockConflictCols and internalTxConflictCols name the unique constraint
+// each table's upsert clause resolves against; blockUpdateCols and
+// internalTxUpdateCols name the columns refreshed on conflict. Postgres
+// needs conflictCols spelled out in the statement, MySQL ignores them (see
+// dialect.Dialect.UpsertClause).
+var (
+	blockConflictCols = []string{"number", "hash"}
+	blockUpdateCols   = []string{"block_data"}
+
+	internalTxConflictCols = []string{"tx_hash", "call_index"}
+	internalTxUpdateCols   = []string{"type", "value", "gas", "gas_used", "input", "output", "error", "revert_reason"}
+)
+
+var (
+	metricsQueueDepth   = metrics.NewRegisteredGauge("explorer/sqlsink/queue", nil)
+	metricsFlushLatency = metrics.NewRegisteredTimer("explorer/sqlsink/flush", nil)
+	metricsRowsWritten  = metrics.NewRegisteredMeter("explorer/sqlsink/rows", nil)
+	metricsDropped      = metrics.NewRegisteredCounter("explorer/sqlsink/dropped", nil)
+)
+
+type eventKind uint8
+
+const (
+	evBlockInsert eventKind = iota
+	evTraceUpdate
+	evInternalTx
+	evBlockDelete
+)
+
+// writerEvent is a single pending write, queued by Sink and consumed by
+// Writer's flush loop. Only the fields relevant to kind are populated.
+type writerEvent struct {
+	kind eventKind
+
+	// number and hash: every kind; data: evBlockInsert, evTraceUpdate
+	number int64
+	hash   string
+	data   string
+
+	// evInternalTx
+	txHash       string
+	txIndex      int
+	callIndex    int
+	traceAddress string
+	depth        int
+	typ          string
+	from         string
+	to           string
+	value        string
+	gas          uint64
+	gasUsed      uint64
+	input        []byte
+	output       []byte
+	errStr       string
+	revertReason string
+}
+
+// Writer batches block_data and internal_transactions writes on its own
+// goroutine, fed by a bounded channel, so a slow database never stalls the
+// block import goroutine. Each flush runs inside a single transaction so a
+// partial failure rolls the whole batch back.
+type Writer struct {
+	db          *sql.DB
+	dialect     dialect.Dialect
+	traceUpdate *sql.Stmt
+	blockDelete *sql.Stmt
+	txDelete    *sql.Stmt
+
+	blockUpsert      string
+	internalTxUpsert string
+
+	// blockInsertFull and internalTxInsertFull are prepared for exactly
+	// defaultBatchSize rows each. execBatchInsert uses them only when one
+	// flush holds exactly that many rows for the table, and falls back to
+	// an ad-hoc query for any other width.
+	blockInsertFull      *sql.Stmt
+	internalTxInsertFull *sql.Stmt
+
+	queue       chan writerEvent
+	batchSize   int
+	flushPeriod time.Duration
+
+	stopc chan struct{}
+	donec chan struct{}
+}
+
+// newWriter prepares the writer's statements, rewriting each query template
+// (authored in MySQL syntax) via d, and starts its flush loop. maxQueue
+// bounds the event channel; zero uses defaultMaxQueue.
+func newWriter(db *sql.DB, d dialect.Dialect, maxQueue int) (*Writer, error) {
+	if maxQueue <= 0 {
+		maxQueue = defaultMaxQueue
+	}
+	traceUpdate, err := db.Prepare(d.Rewrite(traceUpdateSQL))
+	if err != nil {
+		return nil, err
+	}
+	blockDelete, err := db.Prepare(d.Rewrite(blockDeleteSQL))
+	if err != nil {
+		return nil, err
+	}
+	txDelete, err := db.Prepare(d.Rewrite(internalTxDeleteSQL))
+	if err != nil {
+		return nil, err
+	}
+	blockUpsert := d.UpsertClause(blockConflictCols, blockUpdateCols)
+	internalTxUpsert := d.UpsertClause(internalTxConflictCols, internalTxUpdateCols)
+	blockInsertFull, err := db.Prepare(d.Rewrite(buildBatchInsertQuery(blockInsertSQL, blockUpsert, 3, defaultBatchSize)))
+	if err != nil {
+		return nil, err
+	}
+	internalTxInsertFull, err := db.Prepare(d.Rewrite(buildBatchInsertQuery(internalTxInsertSQL, internalTxUpsert, 17, defaultBatchSize)))
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		db:                   db,
+		dialect:              d,
+		traceUpdate:          traceUpdate,
+		blockDelete:          blockDelete,
+		txDelete:             txDelete,
+		blockUpsert:          blockUpsert,
+		internalTxUpsert:     internalTxUpsert,
+		blockInsertFull:      blockInsertFull,
+		internalTxInsertFull: internalTxInsertFull,
+		queue:                make(chan writerEvent, maxQueue),
+		batchSize:            defaultBatchSize,
+		flushPeriod:          defaultFlushPeriod,
+		stopc:                make(chan struct{}),
+		donec:                make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// enqueue buffers ev for the next flush. If the queue is full, ev is
+// dropped and a warning is logged rather than blocking the caller.
+func (w *Writer) enqueue(ev writerEvent) {
+	select {
+	case w.queue <- ev:
+		metricsQueueDepth.Update(int64(len(w.queue)))
+	default:
+		metricsDropped.Inc(1)
+		log.Warn("explorer sqlsink queue full, dropping event", "kind", ev.kind, "maxQueue", cap(w.queue))
+	}
+}
+
+// Close flushes any buffered events and stops the writer goroutine.
+func (w *Writer) Close() {
+	close(w.stopc)
+	<-w.donec
+}
+
+func (w *Writer) loop() {
+	defer close(w.donec)
+	ticker := time.NewTicker(w.flushPeriod)
+	defer ticker.Stop()
+
+	batch := make([]writerEvent, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		start := time.Now()
+		if err := w.flush(batch); err != nil {
+			log.Error("Failed to flush explorer sqlsink batch", "rows", len(batch), "err", err)
+		} else {
+			metricsRowsWritten.Mark(int64(len(batch)))
+		}
+		metricsFlushLatency.UpdateSince(start)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case ev := <-w.queue:
+			metricsQueueDepth.Update(int64(len(w.queue)))
+			batch = append(batch, ev)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-w.stopc:
+			// Drain whatever is still queued before the final flush.
+			for {
+				select {
+				case ev := <-w.queue:
+					batch = append(batch, ev)
+					if len(batch) >= w.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes one batch inside a single transaction, batching same-kind
+// rows into multi-row INSERTs.
+func (w *Writer) flush(batch []writerEvent) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var blockRows, traceRows, txRows, deleteRows []writerEvent
+	for _, ev := range batch {
+		switch ev.kind {
+		case evBlockInsert:
+			blockRows = append(blockRows, ev)
+		case evTraceUpdate:
+			traceRows = append(traceRows, ev)
+		case evInternalTx:
+			txRows = append(txRows, ev)
+		case evBlockDelete:
+			deleteRows = append(deleteRows, ev)
+		}
+	}
+
+	// Delete rows for reorged-out blocks first, in the same transaction as
+	// any inserts that follow for blocks that just became canonical.
+	blockDelete, txDelete := tx.Stmt(w.blockDelete), tx.Stmt(w.txDelete)
+	for _, ev := range deleteRows {
+		if _, err := txDelete.Exec(ev.number, ev.hash); err != nil {
+			return err
+		}
+		if _, err := blockDelete.Exec(ev.number, ev.hash); err != nil {
+			return err
+		}
+	}
+
+	if len(blockRows) > 0 {
+		if err := w.execBatchInsert(tx, w.blockInsertFull, blockInsertSQL, w.blockUpsert, 3, blockRows, func(ev writerEvent) []interface{} {
+			return []interface{}{ev.number, ev.hash, ev.data}
+		}); err != nil {
+			return err
+		}
+	}
+
+	traceUpdate := tx.Stmt(w.traceUpdate)
+	for _, ev := range traceRows {
+		if _, err := traceUpdate.Exec(ev.data, ev.number, ev.hash); err != nil {
+			return err
+		}
+	}
+
+	if len(txRows) > 0 {
+		if err := w.execBatchInsert(tx, w.internalTxInsertFull, internalTxInsertSQL, w.internalTxUpsert, 17, txRows, func(ev writerEvent) []interface{} {
+			return []interface{}{
+				ev.txHash, ev.number, ev.hash, ev.txIndex, ev.callIndex, ev.traceAddress, ev.depth, ev.typ,
+				ev.from, ev.to, ev.value, ev.gas, ev.gasUsed, ev.input, ev.output, ev.errStr, ev.revertReason,
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// buildBatchInsertQuery assembles prefix as a single multi-row INSERT
+// covering rows rows, each contributing width placeholders, followed by
+// suffix (e.g. an ON DUPLICATE KEY UPDATE clause). The query is still in
+// MySQL syntax; the caller rewrites it for the target dialect.
+func buildBatchInsertQuery(prefix, suffix string, width, rows int) string {
+	group := "(" + strings.TrimSuffix(strings.Repeat("?,", width), ",") + ")"
+	groups := make([]string, rows)
+	for i := range groups {
+		groups[i] = group
+	}
+	return prefix + strings.Join(groups, ",") + suffix
+}
+
+// execBatchInsert runs a multi-row INSERT for rows, each contributing width
+// placeholders via args. When rows is exactly defaultBatchSize wide it
+// reuses full, the statement newWriter prepared for that width. A flush
+// splits its batch by table, so this happens only when every event in a
+// full batch is for the same table. Any other width falls back to
+// assembling and running the query ad hoc, since
+// Postgres's sequential $N placeholders can only be numbered once the full
+// multi-row VALUES clause is known, and preparing a statement per distinct
+// partial width isn't worth it for what's normally the smaller, less
+// frequent flush.
+func (w *Writer) execBatchInsert(tx *sql.Tx, full *sql.Stmt, prefix, suffix string, width int, rows []writerEvent, args func(writerEvent) []interface{}) error {
+	values := make([]interface{}, 0, len(rows)*width)
+	for _, row := range rows {
+		values = append(values, args(row)...)
+	}
+	if len(rows) == w.batchSize {
+		_, err := tx.Stmt(full).Exec(values...)
+		return err
+	}
+	query := w.dialect.Rewrite(buildBatchInsertQuery(prefix, suffix, width, len(rows)))
+	_, err := tx.Exec(query, values...)
+	return err
+}
@@ -0,0 +1,11 @@
+package sqlsink
+
+import "testing"
+
+func TestBuildBatchInsertQuery(t *testing.T) {
+	got := buildBatchInsertQuery("INSERT INTO t (a, b) VALUES ", " ON DUPLICATE KEY UPDATE b = VALUES(b)", 2, 3)
+	want := "INSERT INTO t (a, b) VALUES (?,?),(?,?),(?,?) ON DUPLICATE KEY UPDATE b = VALUES(b)"
+	if got != want {
+		t.Errorf("buildBatchInsertQuery() = %q, want %q", got, want)
+	}
+}